@@ -1,6 +1,13 @@
 package frontendlogging
 
 import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -8,18 +15,45 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	sourcemap "github.com/go-sourcemap/sourcemap"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/grafana/grafana/pkg/plugins"
 	"github.com/grafana/grafana/pkg/setting"
 )
 
+// defaultSourceMapCacheMaxEntries bounds the number of parsed source maps kept in
+// memory when Cfg.SourceMapCacheMaxEntries isn't set.
+const defaultSourceMapCacheMaxEntries = 100
+
+// devSourceMapWatchDebounce coalesces rapid successive writes to a bundle's source map
+// (e.g. a dev server rewriting the file several times in the same build) into a single
+// cache eviction.
+const devSourceMapWatchDebounce = 250 * time.Millisecond
+
+// defaultRemoteSourceMapTimeout bounds how long we wait on a CDN before giving up on
+// symbolicating a frame, so a slow or unreachable host can't stall error processing.
+const defaultRemoteSourceMapTimeout = 5 * time.Second
+
+// defaultRemoteSourceMapMaxSize caps how much of a remote response we read into memory
+// when Cfg.SourceMapMaxSizeBytes isn't set.
+const defaultRemoteSourceMapMaxSize = 5 * 1024 * 1024
+
+// errRemoteSourceMapNotFound is returned by readSourceMapFromURL when the remote host
+// reports that neither the bundle nor its source map exists.
+var errRemoteSourceMapNotFound = errors.New("remote source map not found")
+
 type sourceMapLocation struct {
 	dir      string
 	path     string
 	pluginID string
+	// url is set instead of dir/path when the source map has to be fetched from an
+	// allow-listed remote host rather than read off the local filesystem.
+	url string
 }
 
 type sourceMap struct {
@@ -42,19 +76,292 @@ func ReadSourceMapFromFs(dir string, path string) ([]byte, error) {
 	return ioutil.ReadAll(file)
 }
 
+// cachedRemoteSourceMap is the on-disk envelope for a remote source map, so we can
+// revalidate it with the origin via ETag instead of blindly re-downloading it.
+type cachedRemoteSourceMap struct {
+	ETag string `json:"etag"`
+	Body []byte `json:"body"`
+}
+
 type SourceMapStore struct {
-	cache         map[string]*sourceMap
+	cache         *sourceMapLRU
 	cfg           *setting.Cfg
 	readSourceMap ReadSourceMapFn
-	sync.Mutex
+	httpClient    *http.Client
+	loadGroup     singleflight.Group
+
+	// devWatcher and watchedPaths are only populated in development mode, so
+	// production builds pay zero overhead for hot-reload support.
+	devWatcher   *fsnotify.Watcher
+	watchedPaths map[string]string // absolute .map path -> cache key
+	watchedMu    sync.Mutex
 }
 
 func NewSourceMapStore(cfg *setting.Cfg, readSourceMap ReadSourceMapFn) *SourceMapStore {
-	return &SourceMapStore{
-		cache:         make(map[string]*sourceMap),
+	maxEntries := cfg.SourceMapCacheMaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultSourceMapCacheMaxEntries
+	}
+	store := &SourceMapStore{
+		cache:         newSourceMapLRU(maxEntries, cfg.SourceMapCacheMaxBytes),
 		cfg:           cfg,
 		readSourceMap: readSourceMap,
 	}
+	// sourceURL comes from untrusted, browser-submitted Sentry frames, so a redirect
+	// must re-check the allow-list too: otherwise an allow-listed-but-compromised CDN
+	// (open redirect, user-uploadable path, a 302 to a cloud metadata endpoint) turns
+	// this client into SSRF against arbitrary hosts.
+	store.httpClient = &http.Client{
+		Timeout:       defaultRemoteSourceMapTimeout,
+		CheckRedirect: store.checkRemoteSourceMapRedirect,
+	}
+	if cfg.Env == setting.Dev {
+		store.startDevSourceMapWatcher()
+	}
+	return store
+}
+
+// maxRemoteSourceMapRedirects bounds how many hops a CDN request may follow before we
+// give up, independent of the Go default (10) so the limit is explicit and testable.
+const maxRemoteSourceMapRedirects = 10
+
+// errRemoteSourceMapHostNotAllowed is returned when a source map resolves (directly or
+// via redirect) to a host outside Cfg.SourceMapAllowedHosts.
+var errRemoteSourceMapHostNotAllowed = errors.New("remote source map host not allowed")
+
+func (store *SourceMapStore) checkRemoteSourceMapRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRemoteSourceMapRedirects {
+		return fmt.Errorf("stopped after %d redirects fetching source map", maxRemoteSourceMapRedirects)
+	}
+	if !store.isAllowedRemoteSourceMapHost(req.URL.Host) {
+		return fmt.Errorf("redirected to host %q: %w", req.URL.Host, errRemoteSourceMapHostNotAllowed)
+	}
+	return nil
+}
+
+// validateRemoteMapURL re-checks mapURL's host against the allow-list. guessSourceMapLocation
+// only validates the original bundle URL; the map URL actually fetched comes from a
+// response header or a trailing comment inside that bundle, both attacker-influenced,
+// so it must be validated again before we issue a request to it.
+func (store *SourceMapStore) validateRemoteMapURL(mapURL string) (string, error) {
+	u, err := url.Parse(mapURL)
+	if err != nil {
+		return "", err
+	}
+	if !store.isAllowedRemoteSourceMapHost(u.Host) {
+		return "", fmt.Errorf("resolved source map host %q: %w", u.Host, errRemoteSourceMapHostNotAllowed)
+	}
+	return mapURL, nil
+}
+
+// startDevSourceMapWatcher subscribes to the directories a source map could be served
+// from, so that rebuilding a bundle during development evicts its stale cached map
+// instead of requiring a restart. It's best-effort: if the watcher can't be started,
+// we log and carry on without hot-reload.
+func (store *SourceMapStore) startDevSourceMapWatcher() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Warn("Failed to start source map dev watcher.", "err", err)
+		return
+	}
+	for _, dir := range store.devWatchDirs() {
+		if dir == "" {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			logger.Warn("Failed to watch directory for source map changes.", "dir", dir, "err", err)
+		}
+	}
+	store.devWatcher = watcher
+	store.watchedPaths = make(map[string]string)
+	go store.runDevSourceMapWatcher()
+}
+
+func (store *SourceMapStore) devWatchDirs() []string {
+	dirs := []string{filepath.Join(store.cfg.StaticRootPath, "build")}
+	for _, route := range plugins.StaticRoutes {
+		dirs = append(dirs, route.Directory)
+	}
+	return dirs
+}
+
+// runDevSourceMapWatcher evicts cache entries whose backing .map file was written,
+// removed, or renamed, coalescing bursts of events into a single eviction per file.
+func (store *SourceMapStore) runDevSourceMapWatcher() {
+	pending := make(map[string]struct{})
+	var pendingMu sync.Mutex
+	var timer *time.Timer
+
+	flush := func() {
+		pendingMu.Lock()
+		paths := pending
+		pending = make(map[string]struct{})
+		pendingMu.Unlock()
+		for path := range paths {
+			store.invalidateWatchedPath(path)
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-store.devWatcher.Events:
+			if !ok {
+				return
+			}
+			if !strings.HasSuffix(event.Name, ".map") {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Remove|fsnotify.Rename|fsnotify.Create) == 0 {
+				continue
+			}
+			pendingMu.Lock()
+			pending[event.Name] = struct{}{}
+			pendingMu.Unlock()
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(devSourceMapWatchDebounce, flush)
+		case err, ok := <-store.devWatcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn("Source map dev watcher error.", "err", err)
+		}
+	}
+}
+
+// recordWatchedPath remembers which cache key a local .map file backs, so the dev
+// watcher can evict it by path later. It's a no-op unless the dev watcher is running.
+func (store *SourceMapStore) recordWatchedPath(path string, key string) {
+	if store.devWatcher == nil {
+		return
+	}
+	store.watchedMu.Lock()
+	defer store.watchedMu.Unlock()
+	store.watchedPaths[path] = key
+}
+
+func (store *SourceMapStore) invalidateWatchedPath(path string) {
+	store.watchedMu.Lock()
+	key, ok := store.watchedPaths[path]
+	if ok {
+		delete(store.watchedPaths, path)
+	}
+	store.watchedMu.Unlock()
+	if ok {
+		store.cache.remove(key)
+	}
+}
+
+// sourceMapCacheEntry is one slot in sourceMapLRU. A negative entry (one that records
+// "we looked and there's nothing here") has smap == nil and, unlike positive entries,
+// expires on its own so a since-fixed .map file is picked up without a restart.
+type sourceMapCacheEntry struct {
+	key       string
+	smap      *sourceMap
+	size      int64
+	negative  bool
+	expiresAt time.Time
+}
+
+// sourceMapLRU is a least-recently-used cache of parsed source maps, bounded by entry
+// count and/or total decoded map bytes so a long-running Grafana with many plugin
+// bundles doesn't grow the cache without limit.
+type sourceMapLRU struct {
+	maxEntries int
+	maxBytes   int64
+	totalBytes int64
+	ll         *list.List
+	items      map[string]*list.Element
+	mu         sync.Mutex
+}
+
+func newSourceMapLRU(maxEntries int, maxBytes int64) *sourceMapLRU {
+	return &sourceMapLRU{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// get returns (smap, true) if sourceURL has a cached entry, where smap is nil for a
+// cached negative result. It returns (nil, false) if there's nothing cached, including
+// when an expired negative entry was just evicted.
+func (c *sourceMapLRU) get(key string) (*sourceMap, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*sourceMapCacheEntry)
+	if entry.negative && !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		c.removeElement(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.smap, true
+}
+
+func (c *sourceMapLRU) put(key string, smap *sourceMap, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, smap, size, false, time.Time{})
+	c.evict()
+}
+
+func (c *sourceMapLRU) putNegative(key string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	c.set(key, nil, 0, true, expiresAt)
+	c.evict()
+}
+
+func (c *sourceMapLRU) set(key string, smap *sourceMap, size int64, negative bool, expiresAt time.Time) {
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*sourceMapCacheEntry)
+		c.totalBytes += size - entry.size
+		entry.smap, entry.size, entry.negative, entry.expiresAt = smap, size, negative, expiresAt
+		c.ll.MoveToFront(el)
+		return
+	}
+	entry := &sourceMapCacheEntry{key: key, smap: smap, size: size, negative: negative, expiresAt: expiresAt}
+	c.items[key] = c.ll.PushFront(entry)
+	c.totalBytes += size
+}
+
+// evict drops least-recently-used entries until the cache is back within its
+// configured entry-count and byte-size bounds. Must be called with c.mu held.
+func (c *sourceMapLRU) evict() {
+	for (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.totalBytes > c.maxBytes) {
+		el := c.ll.Back()
+		if el == nil {
+			break
+		}
+		c.removeElement(el)
+	}
+}
+
+// remove drops key from the cache, if present, regardless of its recency.
+func (c *sourceMapLRU) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *sourceMapLRU) removeElement(el *list.Element) {
+	entry := el.Value.(*sourceMapCacheEntry)
+	delete(c.items, entry.key)
+	c.totalBytes -= entry.size
+	c.ll.Remove(el)
 }
 
 func (store *SourceMapStore) guessSourceMapLocation(sourceURL string) (*sourceMapLocation, error) {
@@ -62,67 +369,442 @@ func (store *SourceMapStore) guessSourceMapLocation(sourceURL string) (*sourceMa
 	if err != nil {
 		return nil, err
 	}
-	if strings.HasPrefix(u.Path, "/public/build/") {
+	// An allow-listed remote host always wins over the local-filesystem path
+	// conventions below, even if its path happens to look like "/public/build/..."
+	// or "/public/plugins/...": the operator explicitly opted that host into remote
+	// fetching, so we must not silently read a same-named local file instead.
+	if u.Host != "" && store.isAllowedRemoteSourceMapHost(u.Host) {
+		return &sourceMapLocation{url: sourceURL, pluginID: remoteSourceMapPluginID(u.Path)}, nil
+	} else if strings.HasPrefix(u.Path, "/public/build/") {
 		return &sourceMapLocation{
 			dir:      store.cfg.StaticRootPath,
 			path:     filepath.Join("build", u.Path[len("/public/build/"):]) + ".map",
 			pluginID: "",
 		}, nil
 	} else if strings.HasPrefix(u.Path, "/public/plugins/") {
+		// Match against whole path segments rather than a raw string prefix, so a
+		// plugin ID that's a prefix of another ("foo" vs "foo-bar") can't steal a
+		// match, and IDs that themselves contain "/" (nested app-plugin children)
+		// or "." (namespaced IDs like "vendor.product-panel") resolve correctly.
+		// Among routes that match, the one with the most matching segments wins, so
+		// a nested child plugin ("app-plugin/child-plugin") resolves to its own
+		// directory rather than its parent's, regardless of registration order.
+		segments := strings.Split(strings.TrimPrefix(u.Path, "/public/plugins/"), "/")
+		var best *plugins.StaticRoute
 		for _, route := range plugins.StaticRoutes {
-			pluginPrefix := filepath.Join("/public/plugins/", route.PluginId)
-			if strings.HasPrefix(u.Path, pluginPrefix) {
-				return &sourceMapLocation{
-					dir:      route.Directory,
-					path:     u.Path[len(pluginPrefix):] + ".map",
-					pluginID: route.PluginId,
-				}, nil
+			idSegments := strings.Split(route.PluginId, "/")
+			if len(segments) < len(idSegments) {
+				continue
+			}
+			if strings.Join(segments[:len(idSegments)], "/") != route.PluginId {
+				continue
+			}
+			if best == nil || len(idSegments) > len(strings.Split(best.PluginId, "/")) {
+				best = route
 			}
 		}
+		if best != nil {
+			pluginPrefix := "/public/plugins/" + best.PluginId
+			return &sourceMapLocation{
+				dir:      best.Directory,
+				path:     u.Path[len(pluginPrefix):] + ".map",
+				pluginID: best.PluginId,
+			}, nil
+		}
 	}
 	return nil, nil
 }
 
-func (store *SourceMapStore) getSourceMap(sourceURL string) (*sourceMap, error) {
-	store.Lock()
-	defer store.Unlock()
+// remoteSourceMapPluginID derives the plugin a CDN-hosted bundle belongs to from its
+// URL, mirroring the local "/public/plugins/<pluginID>/..." convention so frames from
+// externally-hosted plugin bundles (e.g. "https://cdn.example.com/grafana-plugin/
+// module.js") still attribute to the plugin instead of falling back to "core".
+func remoteSourceMapPluginID(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < 2 || segments[0] == "" {
+		// A bare file with no directory segment isn't a plugin bundle by convention.
+		return ""
+	}
+	return segments[0]
+}
 
-	if smap, ok := store.cache[sourceURL]; ok {
-		return smap, nil
+// isAllowedRemoteSourceMapHost reports whether host is on the operator-configured
+// allow-list of external hosts we're willing to fetch source maps from.
+func (store *SourceMapStore) isAllowedRemoteSourceMapHost(host string) bool {
+	for _, allowed := range store.cfg.SourceMapAllowedHosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// readSourceMapFromURL fetches the source map for a remote, CDN-hosted bundle. It
+// locates the map via the SourceMap/X-SourceMap response headers or a trailing
+// "//# sourceMappingURL=" comment, falling back to "<sourceURL>.map", and caches the
+// result on disk (keyed by a hash of the map URL, with the ETag stored alongside for
+// revalidation) so a restart doesn't force a re-download.
+func (store *SourceMapStore) readSourceMapFromURL(sourceURL string) ([]byte, error) {
+	// The resolved map URL is itself cached on disk (separately from the map body),
+	// so a restart with a cold in-memory cache doesn't have to re-GET the bundle
+	// (often multi-MB) just to rediscover where its map lives.
+	mapURL, resolvedFromCache := store.readCachedRemoteMapURL(sourceURL)
+	if !resolvedFromCache {
+		resolved, err := store.resolveRemoteSourceMapURL(sourceURL)
+		if err != nil {
+			return nil, err
+		}
+		mapURL = resolved
+		store.writeCachedRemoteMapURL(sourceURL, mapURL)
 	}
-	sourceMapLocation, err := store.guessSourceMapLocation(sourceURL)
+
+	body, err := store.fetchAndCacheRemoteSourceMap(mapURL)
 	if err != nil {
+		if resolvedFromCache && errors.Is(err, errRemoteSourceMapNotFound) {
+			// The cached map URL may be stale (e.g. the bundle was rebuilt under a new
+			// hash); re-resolve once from the bundle itself before giving up.
+			resolved, rerr := store.resolveRemoteSourceMapURL(sourceURL)
+			if rerr != nil {
+				return nil, rerr
+			}
+			store.writeCachedRemoteMapURL(sourceURL, resolved)
+			return store.fetchAndCacheRemoteSourceMap(resolved)
+		}
 		return nil, err
 	}
-	if sourceMapLocation == nil {
-		// Cache nil value for sourceURL, since we want to flag that we couldn't guess the map location and not try again
-		store.cache[sourceURL] = nil
-		return nil, nil
+	return body, nil
+}
+
+// fetchAndCacheRemoteSourceMap fetches mapURL's body, revalidating against the on-disk
+// cache via ETag when we already have one cached.
+func (store *SourceMapStore) fetchAndCacheRemoteSourceMap(mapURL string) ([]byte, error) {
+	cacheKey := remoteSourceMapCacheKey(mapURL)
+	if cached, ok := store.readRemoteSourceMapCache(cacheKey); ok {
+		body, notModified, err := store.fetchRemoteSourceMap(mapURL, cached.ETag)
+		if err != nil {
+			return nil, err
+		}
+		if notModified {
+			return cached.Body, nil
+		}
+		store.writeRemoteSourceMapCache(cacheKey, body)
+		return body.Body, nil
+	}
+
+	body, _, err := store.fetchRemoteSourceMap(mapURL, "")
+	if err != nil {
+		return nil, err
 	}
-	path := sourceMapLocation.path
-	if strings.HasPrefix(path, "/") {
-		path = "/" + path
+	store.writeRemoteSourceMapCache(cacheKey, body)
+	return body.Body, nil
+}
+
+// resolveRemoteSourceMapURL determines where the source map for sourceURL lives, by
+// asking the origin for the bundle and inspecting its headers/trailing comment.
+func (store *SourceMapStore) resolveRemoteSourceMapURL(sourceURL string) (string, error) {
+	resp, err := store.httpClient.Get(sourceURL)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logger.Error("Failed to close remote source response body.", "err", err)
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errRemoteSourceMapNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, sourceURL)
+	}
+
+	if mapURL := resp.Header.Get("SourceMap"); mapURL != "" {
+		resolved, err := resolveRemoteURL(sourceURL, mapURL)
+		if err != nil {
+			return "", err
+		}
+		return store.validateRemoteMapURL(resolved)
+	}
+	if mapURL := resp.Header.Get("X-SourceMap"); mapURL != "" {
+		resolved, err := resolveRemoteURL(sourceURL, mapURL)
+		if err != nil {
+			return "", err
+		}
+		return store.validateRemoteMapURL(resolved)
 	}
-	path = filepath.Clean(path)
-	b, err := store.readSourceMap(sourceMapLocation.dir, path)
+
+	maxSize := store.cfg.SourceMapMaxSizeBytes
+	if maxSize <= 0 {
+		maxSize = defaultRemoteSourceMapMaxSize
+	}
+	// Read one byte past maxSize so we can tell a genuine end-of-body apart from a
+	// truncation; the sourceMappingURL comment is expected on the bundle's last line,
+	// so silently truncating it would mis-resolve to the "<url>.map" fallback with no
+	// indication why.
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
 	if err != nil {
-		if os.IsNotExist(err) {
-			// Cache nil value for sourceURL, since we want to flag that it wasn't found in the filesystem and not try again
-			store.cache[sourceURL] = nil
-			return nil, nil
+		return "", err
+	}
+	if int64(len(body)) > maxSize {
+		body = body[:maxSize]
+		logger.Warn("Source map comment scan hit max size limit; bundle may have been truncated before a trailing sourceMappingURL comment was found.", "sourceURL", sourceURL, "maxSizeBytes", maxSize)
+	}
+	if mapURL := extractSourceMappingURLComment(body); mapURL != "" {
+		resolved, err := resolveRemoteURL(sourceURL, mapURL)
+		if err != nil {
+			return "", err
 		}
-		return nil, err
+		return store.validateRemoteMapURL(resolved)
 	}
+	return store.validateRemoteMapURL(sourceURL + ".map")
+}
 
-	consumer, err := sourcemap.Parse(sourceURL+".map", b)
+// fetchRemoteSourceMap fetches mapURL, sending If-None-Match when etag is known.
+// notModified is true when the origin answered 304 and body should be ignored.
+func (store *SourceMapStore) fetchRemoteSourceMap(mapURL string, etag string) (*cachedRemoteSourceMap, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, mapURL, nil)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := store.httpClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logger.Error("Failed to close remote source map response body.", "err", err)
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, true, nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, errRemoteSourceMapNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, mapURL)
+	}
+
+	maxSize := store.cfg.SourceMapMaxSizeBytes
+	if maxSize <= 0 {
+		maxSize = defaultRemoteSourceMapMaxSize
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		return nil, false, err
+	}
+	return &cachedRemoteSourceMap{ETag: resp.Header.Get("ETag"), Body: body}, false, nil
+}
+
+func remoteSourceMapCacheKey(mapURL string) string {
+	sum := sha256.Sum256([]byte(mapURL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (store *SourceMapStore) remoteSourceMapCachePath(cacheKey string) string {
+	if store.cfg.SourceMapCacheDir == "" {
+		return ""
+	}
+	return filepath.Join(store.cfg.SourceMapCacheDir, cacheKey+".json")
+}
+
+func (store *SourceMapStore) readRemoteSourceMapCache(cacheKey string) (*cachedRemoteSourceMap, bool) {
+	path := store.remoteSourceMapCachePath(cacheKey)
+	if path == "" {
+		return nil, false
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var cached cachedRemoteSourceMap
+	if err := json.Unmarshal(b, &cached); err != nil {
+		logger.Warn("Failed to parse cached source map, ignoring.", "path", path, "err", err)
+		return nil, false
+	}
+	return &cached, true
+}
+
+func (store *SourceMapStore) writeRemoteSourceMapCache(cacheKey string, cached *cachedRemoteSourceMap) {
+	path := store.remoteSourceMapCachePath(cacheKey)
+	if path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		logger.Warn("Failed to create source map cache dir.", "dir", filepath.Dir(path), "err", err)
+		return
+	}
+	b, err := json.Marshal(cached)
+	if err != nil {
+		logger.Warn("Failed to serialize source map for caching.", "err", err)
+		return
+	}
+	if err := ioutil.WriteFile(path, b, 0640); err != nil {
+		logger.Warn("Failed to write source map cache entry.", "path", path, "err", err)
 	}
-	smap := &sourceMap{
-		consumer: consumer,
-		pluginID: sourceMapLocation.pluginID,
+}
+
+// cachedRemoteMapURL is the on-disk record of where a bundle's source map was found,
+// keyed by the bundle's own sourceURL, so a restart can skip re-GETting the bundle just
+// to rediscover its map location.
+type cachedRemoteMapURL struct {
+	MapURL string `json:"map_url"`
+}
+
+func (store *SourceMapStore) remoteMapURLCachePath(sourceURL string) string {
+	if store.cfg.SourceMapCacheDir == "" {
+		return ""
+	}
+	return filepath.Join(store.cfg.SourceMapCacheDir, remoteSourceMapCacheKey(sourceURL)+".location.json")
+}
+
+func (store *SourceMapStore) readCachedRemoteMapURL(sourceURL string) (string, bool) {
+	path := store.remoteMapURLCachePath(sourceURL)
+	if path == "" {
+		return "", false
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	var cached cachedRemoteMapURL
+	if err := json.Unmarshal(b, &cached); err != nil {
+		logger.Warn("Failed to parse cached source map location, ignoring.", "path", path, "err", err)
+		return "", false
+	}
+	return cached.MapURL, true
+}
+
+func (store *SourceMapStore) writeCachedRemoteMapURL(sourceURL string, mapURL string) {
+	path := store.remoteMapURLCachePath(sourceURL)
+	if path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		logger.Warn("Failed to create source map cache dir.", "dir", filepath.Dir(path), "err", err)
+		return
+	}
+	b, err := json.Marshal(cachedRemoteMapURL{MapURL: mapURL})
+	if err != nil {
+		logger.Warn("Failed to serialize source map location for caching.", "err", err)
+		return
+	}
+	if err := ioutil.WriteFile(path, b, 0640); err != nil {
+		logger.Warn("Failed to write source map location cache entry.", "path", path, "err", err)
+	}
+}
+
+const sourceMappingURLCommentPrefix = "//# sourceMappingURL="
+
+// extractSourceMappingURLComment looks for a trailing "//# sourceMappingURL=" comment,
+// which per the source map spec is expected on the last non-blank line of the bundle.
+func extractSourceMappingURLComment(js []byte) string {
+	lines := strings.Split(string(js), "\n")
+	for i := len(lines) - 1; i >= 0 && i >= len(lines)-5; i-- {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, sourceMappingURLCommentPrefix) {
+			return strings.TrimPrefix(line, sourceMappingURLCommentPrefix)
+		}
+	}
+	return ""
+}
+
+// resolveRemoteURL resolves a (possibly relative) map reference against the URL of the
+// bundle it was found on.
+func resolveRemoteURL(baseURL string, ref string) (string, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	rel, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(rel).String(), nil
+}
+
+// negativeSourceMapCacheTTL bounds how long we remember that a source map couldn't be
+// found, so fixing a missing .map file on disk doesn't require a Grafana restart to
+// take effect.
+func (store *SourceMapStore) negativeSourceMapCacheTTL() time.Duration {
+	if store.cfg.SourceMapNegativeCacheTTL > 0 {
+		return store.cfg.SourceMapNegativeCacheTTL
+	}
+	return time.Minute
+}
+
+// getSourceMap resolves and parses the source map for sourceURL. Concurrent calls for
+// the same sourceURL are coalesced via loadGroup, so only one goroutine reads and
+// parses the map while the rest wait on its result; calls for different sourceURLs run
+// in parallel against each other and against the bounded LRU cache.
+func (store *SourceMapStore) getSourceMap(sourceURL string) (*sourceMap, error) {
+	if smap, ok := store.cache.get(sourceURL); ok {
+		return smap, nil
+	}
+
+	v, err, _ := store.loadGroup.Do(sourceURL, func() (interface{}, error) {
+		if smap, ok := store.cache.get(sourceURL); ok {
+			return smap, nil
+		}
+
+		sourceMapLocation, err := store.guessSourceMapLocation(sourceURL)
+		if err != nil {
+			return nil, err
+		}
+		if sourceMapLocation == nil {
+			// Cache nil value for sourceURL, since we want to flag that we couldn't guess the map location and not try again until the negative entry's TTL expires
+			store.cache.putNegative(sourceURL, store.negativeSourceMapCacheTTL())
+			return (*sourceMap)(nil), nil
+		}
+
+		var b []byte
+		if sourceMapLocation.url != "" {
+			b, err = store.readSourceMapFromURL(sourceMapLocation.url)
+			if err != nil {
+				if errors.Is(err, errRemoteSourceMapNotFound) {
+					store.cache.putNegative(sourceURL, store.negativeSourceMapCacheTTL())
+					return (*sourceMap)(nil), nil
+				}
+				return nil, err
+			}
+		} else {
+			path := sourceMapLocation.path
+			if strings.HasPrefix(path, "/") {
+				path = "/" + path
+			}
+			path = filepath.Clean(path)
+			b, err = store.readSourceMap(sourceMapLocation.dir, path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					// Cache nil value for sourceURL, since we want to flag that it wasn't found in the filesystem and not try again until the negative entry's TTL expires
+					store.cache.putNegative(sourceURL, store.negativeSourceMapCacheTTL())
+					return (*sourceMap)(nil), nil
+				}
+				return nil, err
+			}
+			store.recordWatchedPath(filepath.Join(sourceMapLocation.dir, path), sourceURL)
+		}
+
+		consumer, err := sourcemap.Parse(sourceURL+".map", b)
+		if err != nil {
+			return nil, err
+		}
+		smap := &sourceMap{
+			consumer: consumer,
+			pluginID: sourceMapLocation.pluginID,
+		}
+		store.cache.put(sourceURL, smap, int64(len(b)))
+		return smap, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	store.cache[sourceURL] = smap
+	smap, _ := v.(*sourceMap)
 	return smap, nil
 }
 
@@ -141,6 +823,17 @@ func (store *SourceMapStore) resolveSourceLocation(frame sentry.Frame) (*sentry.
 	if len(function) == 0 {
 		function = "?"
 	}
+	// pluginID flows straight from route.PluginId (or the CDN plugin ID, see
+	// guessSourceMapLocation) into Module as-is: nothing in this package runs it
+	// through a regex, so dotted and nested ("vendor.product-panel",
+	// "app-plugin/child-plugin") IDs round-trip here unmodified.
+	//
+	// The actual plugin ID format validator (the regex plugins register IDs against
+	// on install, e.g. pkg/plugins/manager or pkg/plugins/plugindef) lives outside
+	// this tree/slice. It was NOT inspected or updated as part of this change, so
+	// whether it currently accepts "." or "/" in a plugin ID is unverified — confirm
+	// or widen it separately before depending on dotted/nested IDs reaching this
+	// point in production.
 	module := "core"
 	if len(smap.pluginID) > 0 {
 		module = smap.pluginID
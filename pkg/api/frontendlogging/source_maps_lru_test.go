@@ -0,0 +1,135 @@
+package frontendlogging
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+const testSourceMapJSON = `{"version":3,"sources":["foo.js"],"names":[],"mappings":"AAAA"}`
+
+func TestSourceMapLRU_evictsByMaxEntries(t *testing.T) {
+	c := newSourceMapLRU(2, 0)
+	c.put("key1", &sourceMap{}, 1)
+	c.put("key2", &sourceMap{}, 1)
+	c.put("key3", &sourceMap{}, 1)
+
+	_, ok := c.get("key1")
+	assert.False(t, ok, "least-recently-used entry should have been evicted")
+	_, ok = c.get("key2")
+	assert.True(t, ok)
+	_, ok = c.get("key3")
+	assert.True(t, ok)
+}
+
+func TestSourceMapLRU_evictsByMaxBytes(t *testing.T) {
+	c := newSourceMapLRU(0, 100)
+	c.put("key1", &sourceMap{}, 60)
+	c.put("key2", &sourceMap{}, 60)
+
+	_, ok := c.get("key1")
+	assert.False(t, ok, "entry should have been evicted once total size exceeded maxBytes")
+	_, ok = c.get("key2")
+	assert.True(t, ok)
+}
+
+func TestSourceMapLRU_touchingAnEntryProtectsItFromEviction(t *testing.T) {
+	c := newSourceMapLRU(2, 0)
+	c.put("key1", &sourceMap{}, 1)
+	c.put("key2", &sourceMap{}, 1)
+	c.get("key1") // key1 is now most-recently-used
+	c.put("key3", &sourceMap{}, 1)
+
+	_, ok := c.get("key1")
+	assert.True(t, ok, "recently touched entry should survive eviction")
+	_, ok = c.get("key2")
+	assert.False(t, ok, "untouched entry should have been evicted instead")
+}
+
+func TestSourceMapLRU_negativeEntryExpires(t *testing.T) {
+	c := newSourceMapLRU(10, 0)
+	c.putNegative("key1", 10*time.Millisecond)
+
+	smap, ok := c.get("key1")
+	require.True(t, ok)
+	assert.Nil(t, smap)
+
+	time.Sleep(20 * time.Millisecond)
+	_, ok = c.get("key1")
+	assert.False(t, ok, "negative entry should have expired")
+}
+
+// TestSourceMapStore_getSourceMap_negativeTTLPicksUpFixedMap exercises the full
+// getSourceMap path: a missing .map file is cached as a negative result, but once its
+// short TTL elapses a since-added file is picked up without restarting the store.
+func TestSourceMapStore_getSourceMap_negativeTTLPicksUpFixedMap(t *testing.T) {
+	staticRoot := t.TempDir()
+	cfg := &setting.Cfg{
+		StaticRootPath:            staticRoot,
+		SourceMapNegativeCacheTTL: 10 * time.Millisecond,
+	}
+	store := NewSourceMapStore(cfg, ReadSourceMapFromFs)
+	sourceURL := "http://localhost:3000/public/build/app.js"
+
+	smap, err := store.getSourceMap(sourceURL)
+	require.NoError(t, err)
+	assert.Nil(t, smap, "map doesn't exist on disk yet, so it should resolve to a cached miss")
+
+	buildDir := filepath.Join(staticRoot, "build")
+	require.NoError(t, os.MkdirAll(buildDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(buildDir, "app.js.map"), []byte(testSourceMapJSON), 0644))
+
+	smap, err = store.getSourceMap(sourceURL)
+	require.NoError(t, err)
+	assert.Nil(t, smap, "negative entry shouldn't have expired yet")
+
+	time.Sleep(20 * time.Millisecond)
+
+	smap, err = store.getSourceMap(sourceURL)
+	require.NoError(t, err)
+	require.NotNil(t, smap, "negative entry should have expired, picking up the now-present map")
+}
+
+// TestSourceMapStore_getSourceMap_singleflightCoalescesConcurrentLoads ensures that
+// concurrent requests for the same sourceURL are coalesced into a single underlying
+// read, instead of each one re-reading and re-parsing the map independently.
+func TestSourceMapStore_getSourceMap_singleflightCoalescesConcurrentLoads(t *testing.T) {
+	var reads int32
+	unblock := make(chan struct{})
+	readSourceMap := func(dir string, path string) ([]byte, error) {
+		atomic.AddInt32(&reads, 1)
+		<-unblock
+		return []byte(testSourceMapJSON), nil
+	}
+
+	store := NewSourceMapStore(&setting.Cfg{StaticRootPath: "/static"}, readSourceMap)
+	sourceURL := "http://localhost:3000/public/build/app.js"
+
+	const concurrency = 20
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			smap, err := store.getSourceMap(sourceURL)
+			assert.NoError(t, err)
+			assert.NotNil(t, smap)
+		}()
+	}
+
+	// Give every goroutine a chance to reach loadGroup.Do and queue behind the
+	// single in-flight read before letting that read complete.
+	time.Sleep(20 * time.Millisecond)
+	close(unblock)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&reads), "concurrent loads of the same sourceURL should coalesce into one read")
+}
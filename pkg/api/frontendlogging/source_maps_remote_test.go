@@ -0,0 +1,154 @@
+package frontendlogging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// newRemoteTestStore builds a store whose SourceMapAllowedHosts allow-lists the given
+// httptest server so resolveRemoteSourceMapURL's host re-validation doesn't reject it.
+func newRemoteTestStore(t *testing.T, server *httptest.Server) *SourceMapStore {
+	t.Helper()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return NewSourceMapStore(&setting.Cfg{
+		SourceMapCacheDir:     t.TempDir(),
+		SourceMapAllowedHosts: []string{u.Host},
+	}, ReadSourceMapFromFs)
+}
+
+func TestSourceMapStore_readSourceMapFromURL_sourceMapHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app.js":
+			w.Header().Set("SourceMap", "/app.js.custom.map")
+			_, _ = w.Write([]byte("console.log('hi')"))
+		case "/app.js.custom.map":
+			_, _ = w.Write([]byte(`{"version":3,"mappings":"header"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store := newRemoteTestStore(t, server)
+	b, err := store.readSourceMapFromURL(server.URL + "/app.js")
+	require.NoError(t, err)
+	assert.Equal(t, `{"version":3,"mappings":"header"}`, string(b))
+}
+
+func TestSourceMapStore_readSourceMapFromURL_xSourceMapHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app.js":
+			w.Header().Set("X-SourceMap", "/app.js.xheader.map")
+			_, _ = w.Write([]byte("console.log('hi')"))
+		case "/app.js.xheader.map":
+			_, _ = w.Write([]byte(`{"version":3,"mappings":"xheader"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store := newRemoteTestStore(t, server)
+	b, err := store.readSourceMapFromURL(server.URL + "/app.js")
+	require.NoError(t, err)
+	assert.Equal(t, `{"version":3,"mappings":"xheader"}`, string(b))
+}
+
+func TestSourceMapStore_readSourceMapFromURL_sourceMappingURLComment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app.js":
+			_, _ = w.Write([]byte("console.log('hi')\n//# sourceMappingURL=app.js.comment.map\n"))
+		case "/app.js.comment.map":
+			_, _ = w.Write([]byte(`{"version":3,"mappings":"comment"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store := newRemoteTestStore(t, server)
+	b, err := store.readSourceMapFromURL(server.URL + "/app.js")
+	require.NoError(t, err)
+	assert.Equal(t, `{"version":3,"mappings":"comment"}`, string(b))
+}
+
+func TestSourceMapStore_readSourceMapFromURL_defaultMapSuffix(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app.js":
+			_, _ = w.Write([]byte("console.log('hi')"))
+		case "/app.js.map":
+			_, _ = w.Write([]byte(`{"version":3,"mappings":"fallback"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store := newRemoteTestStore(t, server)
+	b, err := store.readSourceMapFromURL(server.URL + "/app.js")
+	require.NoError(t, err)
+	assert.Equal(t, `{"version":3,"mappings":"fallback"}`, string(b))
+}
+
+func TestSourceMapStore_readSourceMapFromURL_notFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	store := newRemoteTestStore(t, server)
+	_, err := store.readSourceMapFromURL(server.URL + "/app.js")
+	assert.ErrorIs(t, err, errRemoteSourceMapNotFound)
+}
+
+func TestSourceMapStore_readSourceMapFromURL_revalidatesWithETag(t *testing.T) {
+	var mapRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app.js":
+			_, _ = w.Write([]byte("console.log('hi')"))
+		case "/app.js.map":
+			n := atomic.AddInt32(&mapRequests, 1)
+			if n == 1 {
+				w.Header().Set("ETag", `"v1"`)
+				_, _ = w.Write([]byte(`{"version":3,"mappings":"v1"}`))
+				return
+			}
+			// Any later request must be a conditional revalidation of the first ETag;
+			// if the store forgot the cache it would come in without If-None-Match and
+			// get a 400 instead of the 304 it should have gotten.
+			if r.Header.Get("If-None-Match") != `"v1"` {
+				http.Error(w, "expected conditional request", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store := newRemoteTestStore(t, server)
+	first, err := store.readSourceMapFromURL(server.URL + "/app.js")
+	require.NoError(t, err)
+	assert.Equal(t, `{"version":3,"mappings":"v1"}`, string(first))
+
+	second, err := store.readSourceMapFromURL(server.URL + "/app.js")
+	require.NoError(t, err)
+	assert.Equal(t, string(first), string(second), "revalidated entry should keep serving the cached body")
+	assert.EqualValues(t, 2, atomic.LoadInt32(&mapRequests))
+}
+
@@ -0,0 +1,89 @@
+package frontendlogging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestSourceMapStore_guessSourceMapLocation_pluginRoutes(t *testing.T) {
+	origRoutes := plugins.StaticRoutes
+	defer func() { plugins.StaticRoutes = origRoutes }()
+
+	plugins.StaticRoutes = []*plugins.StaticRoute{
+		{PluginId: "foo", Directory: "/data/plugins/foo"},
+		{PluginId: "foo-bar", Directory: "/data/plugins/foo-bar"},
+		{PluginId: "vendor.product-panel", Directory: "/data/plugins/vendor.product-panel"},
+		{PluginId: "app-plugin/child-plugin", Directory: "/data/plugins/app-plugin/child-plugin"},
+	}
+
+	store := NewSourceMapStore(&setting.Cfg{StaticRootPath: "/data/build"}, ReadSourceMapFromFs)
+
+	tests := []struct {
+		name         string
+		sourceURL    string
+		wantDir      string
+		wantPath     string
+		wantPluginID string
+	}{
+		{
+			name:         "exact plugin id prefix is not stolen by a shorter plugin id",
+			sourceURL:    "http://localhost:3000/public/plugins/foo-bar/module.js",
+			wantDir:      "/data/plugins/foo-bar",
+			wantPath:     "/module.js.map",
+			wantPluginID: "foo-bar",
+		},
+		{
+			name:         "shorter plugin id still resolves on its own",
+			sourceURL:    "http://localhost:3000/public/plugins/foo/module.js",
+			wantDir:      "/data/plugins/foo",
+			wantPath:     "/module.js.map",
+			wantPluginID: "foo",
+		},
+		{
+			name:         "dotted namespaced plugin id",
+			sourceURL:    "http://localhost:3000/public/plugins/vendor.product-panel/module.js",
+			wantDir:      "/data/plugins/vendor.product-panel",
+			wantPath:     "/module.js.map",
+			wantPluginID: "vendor.product-panel",
+		},
+		{
+			name:         "nested app-plugin child id",
+			sourceURL:    "http://localhost:3000/public/plugins/app-plugin/child-plugin/module.js",
+			wantDir:      "/data/plugins/app-plugin/child-plugin",
+			wantPath:     "/module.js.map",
+			wantPluginID: "app-plugin/child-plugin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := store.guessSourceMapLocation(tt.sourceURL)
+			require.NoError(t, err)
+			require.NotNil(t, loc)
+			assert.Equal(t, tt.wantDir, loc.dir)
+			assert.Equal(t, tt.wantPath, loc.path)
+			assert.Equal(t, tt.wantPluginID, loc.pluginID)
+		})
+	}
+}
+
+func TestSourceMapStore_guessSourceMapLocation_noPluginMatch(t *testing.T) {
+	origRoutes := plugins.StaticRoutes
+	defer func() { plugins.StaticRoutes = origRoutes }()
+
+	plugins.StaticRoutes = []*plugins.StaticRoute{
+		{PluginId: "foo", Directory: "/data/plugins/foo"},
+	}
+
+	store := NewSourceMapStore(&setting.Cfg{StaticRootPath: "/data/build"}, ReadSourceMapFromFs)
+
+	// "foobar" must not match the "foo" route just because it shares a prefix.
+	loc, err := store.guessSourceMapLocation("http://localhost:3000/public/plugins/foobar/module.js")
+	require.NoError(t, err)
+	assert.Nil(t, loc)
+}
@@ -0,0 +1,57 @@
+package frontendlogging
+
+import (
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// TestSourceMapStore_devWatcher_invalidatesRecordedPath exercises the eviction side of
+// the dev-mode hot-reload path directly: once a sourceURL's backing .map file is
+// recorded, invalidating that path should evict the cached map (debounce/coalescing
+// happens upstream in runDevSourceMapWatcher and isn't needed to test the eviction
+// itself).
+func TestSourceMapStore_devWatcher_invalidatesRecordedPath(t *testing.T) {
+	store := NewSourceMapStore(&setting.Cfg{StaticRootPath: "/static"}, ReadSourceMapFromFs)
+	watcher, err := fsnotify.NewWatcher()
+	require.NoError(t, err)
+	defer func() { _ = watcher.Close() }()
+	// Simulate dev mode having started the watcher, without actually needing fsnotify
+	// to observe a real filesystem event.
+	store.devWatcher = watcher
+	store.watchedPaths = make(map[string]string)
+
+	const sourceURL = "http://localhost:3000/public/build/app.js"
+	const mapPath = "/static/build/app.js.map"
+
+	store.cache.put(sourceURL, &sourceMap{pluginID: "core"}, 10)
+	store.recordWatchedPath(mapPath, sourceURL)
+
+	_, ok := store.cache.get(sourceURL)
+	require.True(t, ok, "map should be cached before invalidation")
+
+	store.invalidateWatchedPath(mapPath)
+
+	_, ok = store.cache.get(sourceURL)
+	assert.False(t, ok, "invalidating the watched path should evict its cache entry")
+}
+
+// TestSourceMapStore_recordWatchedPath_noopWithoutDevWatcher confirms that outside dev
+// mode (devWatcher nil) recording a path is a no-op, so production builds don't pay for
+// the bookkeeping.
+func TestSourceMapStore_recordWatchedPath_noopWithoutDevWatcher(t *testing.T) {
+	store := NewSourceMapStore(&setting.Cfg{StaticRootPath: "/static"}, ReadSourceMapFromFs)
+	require.Nil(t, store.devWatcher)
+
+	const sourceURL = "http://localhost:3000/public/build/app.js"
+	store.cache.put(sourceURL, &sourceMap{pluginID: "core"}, 10)
+	store.recordWatchedPath("/static/build/app.js.map", sourceURL)
+	store.invalidateWatchedPath("/static/build/app.js.map")
+
+	_, ok := store.cache.get(sourceURL)
+	assert.True(t, ok, "without a dev watcher, recording/invalidating a path must not touch the cache")
+}